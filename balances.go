@@ -0,0 +1,48 @@
+package main
+
+import "sync"
+
+// BalanceIndex はチェーン上のトランザクションを再生して得られる、各アドレスの残高を保持する
+//
+// Sender が coinbaseSender（"0"）のトランザクションは採掘報酬として扱われ、
+// 送信者からの残高の減算を行わない
+type BalanceIndex struct {
+	mu       sync.Mutex
+	balances map[string]int
+}
+
+// NewBalanceIndex は空の BalanceIndex を作る
+func NewBalanceIndex() *BalanceIndex {
+	return &BalanceIndex{balances: make(map[string]int)}
+}
+
+// Balance は address の残高を返す。まだ何も反映されていなければ0を返す
+func (bi *BalanceIndex) Balance(address string) int {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	return bi.balances[address]
+}
+
+// Apply は tx を残高に反映する。Sender から Amount を引き、Recipient に Amount を足す
+func (bi *BalanceIndex) Apply(tx *Transaction) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	if tx.Sender != coinbaseSender {
+		bi.balances[tx.Sender] -= tx.Amount
+	}
+	bi.balances[tx.Recipient] += tx.Amount
+}
+
+// validateAndApplyBlockBalances は txs を順番に balances へ反映する
+//
+// コインベース以外のトランザクションが反映前の残高を超えて送金しようとしていれば、
+// その時点で反映を止めて false を返す
+func validateAndApplyBlockBalances(balances *BalanceIndex, txs []*Transaction) (bool, error) {
+	for _, tx := range txs {
+		if tx.Sender != coinbaseSender && balances.Balance(tx.Sender) < tx.Amount {
+			return false, nil
+		}
+		balances.Apply(tx)
+	}
+	return true, nil
+}
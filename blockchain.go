@@ -4,9 +4,8 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,6 +14,35 @@ type Blockchain struct {
 	Chain               []*Block
 	CurrentTransactions []*Transaction
 	Nodes               map[string]bool // python における set
+
+	// mu は Chain と CurrentTransactions への同時アクセスを防ぐ
+	//
+	// /mine・/transactions/new・/transactions/receive・/blocks/receive はそれぞれ
+	// net/http の別ゴルーチンで動くため、これらを素の mutex なしで読み書きすると競合する
+	mu sync.Mutex
+
+	store           Store
+	targetBlockTime time.Duration
+	gossipFanout    int
+	gossipBackoff   time.Duration
+	seenTxs         *seenCache
+	balances        *BalanceIndex
+	coinbaseReward  int
+	halvingInterval int
+}
+
+// BlockchainConfig はブロックチェーンの難易度リターゲット・ゴシップ伝播・採掘報酬の挙動をまとめたもの
+type BlockchainConfig struct {
+	// TargetBlockTime は難易度のリターゲットが目標とする1ブロックあたりの生成時間
+	TargetBlockTime time.Duration
+	// GossipFanout は新しいトランザクション・ブロックを一度に送信するピアの最大数
+	GossipFanout int
+	// GossipBackoff は応答のないピアへの送信を諦めるまでのタイムアウト
+	GossipBackoff time.Duration
+	// CoinbaseReward は半減前の採掘報酬
+	CoinbaseReward int
+	// HalvingInterval はこの数のブロックが採掘されるたびに採掘報酬を半減させる間隔
+	HalvingInterval int
 }
 
 type Block struct {
@@ -23,22 +51,62 @@ type Block struct {
 	Transactions []*Transaction `json:"transactions"`
 	Proof        int            `json:"proof"`
 	PreviousHash string         `json:"previous_hash"`
+	Difficulty   int            `json:"difficulty"`
+	MerkleRoot   string         `json:"merkle_root"`
 }
 
-type Transaction struct {
-	Sender    string `json:"sender"`
-	Recipient string `json:"recipient"`
-	Amount    int    `json:"amount"`
-}
-
-func InitBlockchain() (*Blockchain, error) {
+// InitBlockchain は store に永続化されているチェーンを読み込んでブロックチェーンを組み立てる
+//
+// 永続化されたブロックが1つもない場合のみ、新しくジェネシスブロックを作る
+// @param store: 永続化を担うストア
+// @param cfg: 難易度リターゲットやゴシップ伝播の設定
+// @return: ブロックチェーン
+// @return: エラー
+func InitBlockchain(store Store, cfg BlockchainConfig) (*Blockchain, error) {
 	bc := &Blockchain{
-		Nodes: make(map[string]bool),
+		Nodes:           make(map[string]bool),
+		store:           store,
+		targetBlockTime: cfg.TargetBlockTime,
+		gossipFanout:    cfg.GossipFanout,
+		gossipBackoff:   cfg.GossipBackoff,
+		coinbaseReward:  cfg.CoinbaseReward,
+		halvingInterval: cfg.HalvingInterval,
+	}
+
+	var loaded bool
+	if err := store.IterateChain(func(b *Block) error {
+		bc.Chain = append(bc.Chain, b)
+		loaded = true
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// すでにチェーンに取り込まれているトランザクションの ID を seenTxs に、
+	// 残高を balances に反映しておく。そうしないと再起動後に同じトランザクションを
+	// 二重に採掘できてしまう
+	if err := bc.rebuildState(); err != nil {
+		return nil, err
+	}
+
+	nodes, err := store.Nodes()
+	if err != nil {
+		return nil, err
 	}
-	// ジェネシスブロックを作る
-	if _, err := bc.NewBlock(100, "1"); err != nil {
+	bc.Nodes = nodes
+
+	pending, err := store.PendingTxs()
+	if err != nil {
 		return nil, err
 	}
+	bc.CurrentTransactions = pending
+
+	if !loaded {
+		// 永続化されたチェーンがない場合はジェネシスブロックを作る
+		if _, err := bc.NewBlock(100, "1"); err != nil {
+			return nil, err
+		}
+	}
 	return bc, nil
 }
 
@@ -50,43 +118,271 @@ func InitBlockchain() (*Blockchain, error) {
 // @return: 新しいブロック
 // @return: エラー
 func (bc *Blockchain) NewBlock(proof int, previousHash string) (*Block, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
 	var prevHash string
 	var err error
 	if len(previousHash) > 0 {
 		prevHash = previousHash
 	} else {
-		prevHash, err = Hash(bc.LastBlock())
+		prevHash, err = Hash(bc.lastBlockLocked())
 		if err != nil {
 			return nil, err
 		}
 	}
+	merkleRoot, err := MerkleRoot(bc.CurrentTransactions)
+	if err != nil {
+		return nil, err
+	}
 	b := &Block{
 		Index:        len(bc.Chain) + 1,
 		Timestamp:    time.Now(),
 		Transactions: bc.CurrentTransactions,
 		Proof:        proof,
 		PreviousHash: prevHash,
+		Difficulty:   bc.currentDifficultyLocked(),
+		MerkleRoot:   merkleRoot,
+	}
+	if err := bc.store.PutBlock(b); err != nil {
+		return nil, err
 	}
+	if err := bc.store.ClearPendingTxs(); err != nil {
+		return nil, err
+	}
+
+	for _, tx := range b.Transactions {
+		bc.balances.Apply(tx)
+	}
+
 	// 現在のトランザクションリストをリセット
 	bc.CurrentTransactions = []*Transaction{}
 	bc.Chain = append(bc.Chain, b)
 	return b, nil
 }
 
+// BlockReceiveOutcome は ReceiveBlock がゴシップで受け取ったブロックをどう扱ったかを表す
+type BlockReceiveOutcome int
+
+const (
+	// BlockAppended はブロックをチェーンの先頭に追加したことを表す
+	BlockAppended BlockReceiveOutcome = iota
+	// BlockIgnored は高さが自らの先端以下のブロックか、無効なブロックだったため何もしなかったことを表す
+	BlockIgnored
+	// BlockHeightMismatch は自らのチェーンより高さが先に進んでいるブロックだったことを表す
+	BlockHeightMismatch
+)
+
+// ReceiveBlock はゴシップで受け取ったブロックを自らのチェーンの先端と照らし合わせて検証する
+//
+// 高さが自らの先端以下のブロックは、既に持っているものかどうかに関わらず無視する
+// 自らの次のブロックとして有効なら追加し、
+// それより高さが先に進んでいれば BlockHeightMismatch を返して呼び出し元に ResolveConflicts を促す
+// @param b: 受け取ったブロック
+// @return: ブロックをどう扱ったか
+// @return: エラー
+func (bc *Blockchain) ReceiveBlock(b *Block) (BlockReceiveOutcome, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	switch {
+	case b.Index <= bc.lastBlockLocked().Index:
+		return BlockIgnored, nil
+	case b.Index > bc.lastBlockLocked().Index+1:
+		return BlockHeightMismatch, nil
+	}
+
+	valid, err := bc.validateNextBlock(b)
+	if err != nil {
+		return BlockIgnored, err
+	}
+	if !valid {
+		return BlockIgnored, nil
+	}
+
+	if err := bc.store.PutBlock(b); err != nil {
+		return BlockIgnored, err
+	}
+	if err := bc.store.ClearPendingTxs(); err != nil {
+		return BlockIgnored, err
+	}
+
+	for _, tx := range b.Transactions {
+		bc.balances.Apply(tx)
+	}
+
+	bc.CurrentTransactions = []*Transaction{}
+	bc.Chain = append(bc.Chain, b)
+	return BlockAppended, nil
+}
+
+// validateNextBlock は b が自らのチェーンの次のブロックとして正しいかを検証する
+//
+// bc.mu を保持している呼び出し元（ReceiveBlock）からのみ呼ばれる
+func (bc *Blockchain) validateNextBlock(b *Block) (bool, error) {
+	last := bc.lastBlockLocked()
+
+	prevHash, err := Hash(last)
+	if err != nil {
+		return false, err
+	}
+	if b.PreviousHash != prevHash {
+		return false, nil
+	}
+
+	if b.Difficulty != bc.currentDifficultyLocked() {
+		return false, nil
+	}
+	if !ValidProof(last.Proof, b.Proof, b.Difficulty) {
+		return false, nil
+	}
+
+	expectedMerkleRoot, err := MerkleRoot(b.Transactions)
+	if err != nil {
+		return false, err
+	}
+	if b.MerkleRoot != expectedMerkleRoot {
+		return false, nil
+	}
+
+	if amount, found := coinbaseAmount(b.Transactions); found && amount != bc.coinbaseRewardAt(len(bc.Chain)) {
+		return false, nil
+	}
+
+	return validateBlockTransactions(b.Transactions)
+}
+
 // 新しいトランザクションをリストに加える
 //
 // 次に採掘されるブロックに加える新しいトランザクションを作る
-// @param sender: 送信者のアドレス
-// @param recipient: 受信者のアドレス
-// @param amount: 量
+// 署名の検証に失敗すると ErrInvalidSignature を、Amount が0以下だと ErrInvalidAmount を、
+// 確定済み残高から未承認の送金分を差し引いた金額を超える送金だと ErrInsufficientBalance を返す
+// コインベース（Sender が "0"）は採掘フローの NewCoinbaseTransaction からのみ作られるため
+// ここでは受け付けず ErrInvalidSender を返す
+// @param tx: 追加するトランザクション
 // @return: このトランザクションを含むブロックのアドレス
-func (bc *Blockchain) NewTransaction(sender, recipient string, amount int) int {
-	bc.CurrentTransactions = append(bc.CurrentTransactions, &Transaction{
-		Sender:    sender,
+// @return: エラー
+func (bc *Blockchain) NewTransaction(tx *Transaction) (int, error) {
+	if tx.Sender == coinbaseSender {
+		return 0, ErrInvalidSender
+	}
+	if tx.Amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+
+	// 公開鍵や署名がデコードできない場合も署名の検証失敗として扱う
+	if ok, err := tx.Verify(); err != nil || !ok {
+		return 0, ErrInvalidSignature
+	}
+
+	txid, err := TxID(tx)
+	if err != nil {
+		return 0, err
+	}
+	if !bc.seenTxs.markSeen(txid) {
+		return 0, ErrDuplicateTransaction
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	available := bc.balances.Balance(tx.Sender) - bc.pendingOutflowLocked(tx.Sender)
+	if tx.Amount > available {
+		return 0, ErrInsufficientBalance
+	}
+
+	return bc.addPendingTransaction(tx)
+}
+
+// NewCoinbaseTransaction は採掘報酬のトランザクションをリストに加える
+//
+// 採掘フロー（HandleMine）からのみ呼ばれることを前提としており、署名や残高の検証は行わない
+// 1ブロックにつき1つまでしか許されない
+// @param recipient: 採掘者のアドレス
+// @param amount: 採掘報酬
+// @return: このトランザクションを含むブロックのアドレス
+// @return: エラー
+func (bc *Blockchain) NewCoinbaseTransaction(recipient string, amount int) (int, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	for _, pending := range bc.CurrentTransactions {
+		if pending.Sender == coinbaseSender {
+			return 0, ErrCoinbaseAlreadyPending
+		}
+	}
+	return bc.addPendingTransaction(&Transaction{
+		Sender:    coinbaseSender,
 		Recipient: recipient,
 		Amount:    amount,
 	})
-	return bc.LastBlock().Index + 1
+}
+
+// addPendingTransaction は検証済みの tx を store に永続化し、現在のトランザクションリストに加える
+//
+// bc.mu を保持している呼び出し元（NewTransaction・NewCoinbaseTransaction）からのみ呼ばれる
+func (bc *Blockchain) addPendingTransaction(tx *Transaction) (int, error) {
+	if err := bc.store.PutPendingTx(tx); err != nil {
+		return 0, err
+	}
+	bc.CurrentTransactions = append(bc.CurrentTransactions, tx)
+	return bc.lastBlockLocked().Index + 1, nil
+}
+
+// Balance は address の確定済み残高（チェーンに取り込まれたトランザクションのみを反映したもの）を返す
+func (bc *Blockchain) Balance(address string) int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.balances.Balance(address)
+}
+
+// PendingOutflow は address が送信者となっている未承認トランザクションの送金額の合計を返す
+func (bc *Blockchain) PendingOutflow(address string) int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.pendingOutflowLocked(address)
+}
+
+// pendingOutflowLocked は bc.mu を保持している呼び出し元からのみ呼ばれる PendingOutflow の実体
+func (bc *Blockchain) pendingOutflowLocked(address string) int {
+	outflow := 0
+	for _, tx := range bc.CurrentTransactions {
+		if tx.Sender == address {
+			outflow += tx.Amount
+		}
+	}
+	return outflow
+}
+
+// CoinbaseReward は次に採掘されるブロックの採掘報酬を返す
+//
+// HalvingInterval ブロックが採掘されるたびに報酬は半減する
+func (bc *Blockchain) CoinbaseReward() int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.coinbaseRewardAt(len(bc.Chain))
+}
+
+// coinbaseRewardAt は height 番目のブロックが採掘された時点での採掘報酬を返す
+//
+// height はそのブロックが採掘される前にチェーンに積まれていたブロック数（= bc.Chain の長さ）
+func (bc *Blockchain) coinbaseRewardAt(height int) int {
+	if bc.halvingInterval <= 0 {
+		return bc.coinbaseReward
+	}
+	halvings := height / bc.halvingInterval
+	return bc.coinbaseReward >> uint(halvings)
+}
+
+// coinbaseAmount は txs の中のコインベース報酬の Amount を返す。コインベースが含まれていなければ
+// found は false になる
+func coinbaseAmount(txs []*Transaction) (amount int, found bool) {
+	for _, tx := range txs {
+		if tx.Sender == coinbaseSender {
+			return tx.Amount, true
+		}
+	}
+	return 0, false
 }
 
 // ブロックをハッシュ化する
@@ -107,37 +403,75 @@ func Hash(b *Block) (string, error) {
 
 // チェーンの最後のブロックをリターンする
 func (bc *Blockchain) LastBlock() *Block {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.lastBlockLocked()
+}
+
+// lastBlockLocked は bc.mu を保持している呼び出し元からのみ呼ばれる LastBlock の実体
+func (bc *Blockchain) lastBlockLocked() *Block {
 	return bc.Chain[len(bc.Chain)-1]
 }
 
-// シンプルなプルーフ・オブ・ワークのアルゴリズム
-// - hash(pp')の最初の4つが0となるような p' を探す
-// - p は1つ前のブロックのプルーフ、p' は新しいブロックのプルーフ
-// @param last_proof
-// @return
-func ProofOfWork(lastProof int) int {
-	proof := 0
-	for !ValidProof(lastProof, proof) {
-		proof += 1
-	}
-	return proof
+// CurrentDifficulty は次に採掘されるブロックに要求される難易度（先頭ゼロビット数）を返す
+func (bc *Blockchain) CurrentDifficulty() int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.currentDifficultyLocked()
+}
+
+// currentDifficultyLocked は bc.mu を保持している呼び出し元からのみ呼ばれる CurrentDifficulty の実体
+func (bc *Blockchain) currentDifficultyLocked() int {
+	return computeDifficulty(bc.Chain, bc.targetBlockTime)
+}
+
+// BlocksUntilRetarget は次の難易度リターゲットまでに採掘が必要なブロック数を返す
+func (bc *Blockchain) BlocksUntilRetarget() int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return retargetInterval - len(bc.Chain)%retargetInterval
+}
+
+// GetBlock はインデックスを指定してブロックを1件だけ取得する
+//
+// チェーン全体をメモリに展開せず、store から直接読み込む
+// @param index: ブロックのインデックス
+// @return: ブロック
+// @return: エラー（見つからない場合は ErrBlockNotFound）
+func (bc *Blockchain) GetBlock(index int) (*Block, error) {
+	return bc.store.GetBlock(index)
+}
+
+// ChainSnapshot はその時点の bc.Chain のコピーを返す
+//
+// 呼び出し元が受け取ったスライスを保持し続けても、その後の採掘やチェーンの
+// 置き換えによる bc.Chain の再代入と競合しないようにする
+func (bc *Blockchain) ChainSnapshot() []*Block {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	chain := make([]*Block, len(bc.Chain))
+	copy(chain, bc.Chain)
+	return chain
 }
 
-// プルーフが正しいかを確認する。hash(last_proof, proof)の最初の4つが0となっているか
-// @param last_proof: 前のプルーフ
-// @param proof: 現在のプルーフ
-// @return: 正しければ true、そうでなければ false
-func ValidProof(lastProof, proof int) bool {
-	guess := fmt.Sprintf("%d%d", lastProof, proof)
-	guessHash := sha256.Sum256([]byte(guess))
-	guessHashString := hex.EncodeToString(guessHash[:])
-	return strings.HasPrefix(guessHashString, "0000")
+// Mempool はその時点の bc.CurrentTransactions のコピーを返す
+func (bc *Blockchain) Mempool() []*Transaction {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	txs := make([]*Transaction, len(bc.CurrentTransactions))
+	copy(txs, bc.CurrentTransactions)
+	return txs
 }
 
 // ノードリストに新しいノードを加える
 // @param address: ノードのアドレス 例: 'http://192.168.0.5:5000'
-func (bc *Blockchain) RegisterNode(address string) {
+// @return: エラー
+func (bc *Blockchain) RegisterNode(address string) error {
+	if err := bc.store.PutNode(address); err != nil {
+		return err
+	}
 	bc.Nodes[address] = true
+	return nil
 }
 
 // ブロックチェーンが正しいかを確認する
@@ -148,11 +482,13 @@ func (bc *Blockchain) ValidChain(chain []*Block) (bool, error) {
 	lastBlock := chain[0]
 	currentIndex := 1
 
+	balances := NewBalanceIndex()
+	for _, tx := range chain[0].Transactions {
+		balances.Apply(tx)
+	}
+
 	for currentIndex < len(chain) {
 		block := chain[currentIndex]
-		fmt.Printf("%v\n", lastBlock)
-		fmt.Printf("%v\n", block)
-		fmt.Print("\n--------------\n")
 
 		// ブロックのハッシュが正しいかを確認
 		prevHash, err := Hash(lastBlock)
@@ -163,8 +499,44 @@ func (bc *Blockchain) ValidChain(chain []*Block) (bool, error) {
 			return false, nil
 		}
 
-		// プルーフ・オブ・ワークが正しいかを確認
-		if !ValidProof(lastBlock.Proof, block.Proof) {
+		// 難易度が正しくリターゲットされているか、プルーフ・オブ・ワークが正しいかを確認
+		expectedDifficulty := computeDifficulty(chain[:currentIndex], bc.targetBlockTime)
+		if block.Difficulty != expectedDifficulty {
+			return false, nil
+		}
+		if !ValidProof(lastBlock.Proof, block.Proof, block.Difficulty) {
+			return false, nil
+		}
+
+		// マークルルートがブロックのトランザクションと一致するかを確認
+		expectedMerkleRoot, err := MerkleRoot(block.Transactions)
+		if err != nil {
+			return false, err
+		}
+		if block.MerkleRoot != expectedMerkleRoot {
+			return false, nil
+		}
+
+		// トランザクションの署名と、コインベース報酬が1ブロックにつき1つまでであることを確認
+		ok, err := validateBlockTransactions(block.Transactions)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+
+		// コインベース報酬がそのブロックの高さにおける期待値と一致するかを確認
+		if amount, found := coinbaseAmount(block.Transactions); found && amount != bc.coinbaseRewardAt(currentIndex) {
+			return false, nil
+		}
+
+		// ブロック内のトランザクションが残高を超えて送金していないかを確認
+		ok, err = validateAndApplyBlockBalances(balances, block.Transactions)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
 			return false, nil
 		}
 
@@ -180,10 +552,13 @@ func (bc *Blockchain) ValidChain(chain []*Block) (bool, error) {
 // @return: エラー
 func (bc *Blockchain) ResolveConflicts() (bool, error) {
 	neighbours := bc.Nodes
-	var newChain []*Block
 
 	// 自らのチェーンより長いチェーンを探す必要がある
+	bc.mu.Lock()
 	maxLength := len(bc.Chain)
+	bc.mu.Unlock()
+
+	var newChain []*Block
 
 	// 他のすべてのノードのチェーンを確認
 	for node, _ := range neighbours {
@@ -212,9 +587,81 @@ func (bc *Blockchain) ResolveConflicts() (bool, error) {
 
 	// もし自らのチェーンより長く、かつ有効なチェーンを見つけた場合それで置き換える
 	if newChain != nil {
+		for _, b := range newChain {
+			if err := bc.store.PutBlock(b); err != nil {
+				return false, err
+			}
+		}
+
+		bc.mu.Lock()
+		defer bc.mu.Unlock()
+
 		bc.Chain = newChain
+		if err := bc.rebuildState(); err != nil {
+			return false, err
+		}
+
+		// 採用したチェーンにすでに取り込まれているトランザクションは、ローカルの
+		// mempool から取り除く。取り除かないと次の NewBlock で再び取り込まれ、
+		// balances に二重に適用されてしまう
+		if err := bc.dropMinedPendingTxs(); err != nil {
+			return false, err
+		}
+
 		return true, nil
 	}
 
 	return false, nil
 }
+
+// dropMinedPendingTxs は bc.CurrentTransactions のうち、採用済みのチェーン
+// （= seenTxs）にすでに含まれているトランザクションを取り除き、store の未承認
+// トランザクションを生き残ったものだけで置き換える
+//
+// bc.mu を保持している呼び出し元（ResolveConflicts）からのみ呼ばれる
+func (bc *Blockchain) dropMinedPendingTxs() error {
+	survivors := bc.CurrentTransactions[:0]
+	for _, tx := range bc.CurrentTransactions {
+		txid, err := TxID(tx)
+		if err != nil {
+			return err
+		}
+		if bc.seenTxs.markSeen(txid) {
+			survivors = append(survivors, tx)
+		}
+	}
+	bc.CurrentTransactions = survivors
+
+	if err := bc.store.ClearPendingTxs(); err != nil {
+		return err
+	}
+	for _, tx := range bc.CurrentTransactions {
+		if err := bc.store.PutPendingTx(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildState は bc.Chain に積まれているトランザクションをすべて再生し、
+// balances と seenTxs を組み立て直す
+//
+// チェーンを丸ごと置き換えた（ResolveConflicts）直後や、store から読み込んだ
+// 直後（InitBlockchain）など、bc.Chain が外部から差し替わったときに呼ぶ
+// InitBlockchain からは構築中の単一ゴルーチンから呼ばれるため bc.mu は不要だが、
+// ResolveConflicts からは bc.mu を保持している状態で呼ぶこと
+func (bc *Blockchain) rebuildState() error {
+	bc.balances = NewBalanceIndex()
+	bc.seenTxs = newSeenCache()
+	for _, b := range bc.Chain {
+		for _, tx := range b.Transactions {
+			bc.balances.Apply(tx)
+			txid, err := TxID(tx)
+			if err != nil {
+				return err
+			}
+			bc.seenTxs.markSeen(txid)
+		}
+	}
+	return nil
+}
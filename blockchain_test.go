@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kawabatas/dvf-blockchain-go/wallet"
+)
+
+func testBlockchainConfig() BlockchainConfig {
+	return BlockchainConfig{
+		TargetBlockTime: time.Minute,
+		GossipFanout:    1,
+		GossipBackoff:   time.Second,
+		CoinbaseReward:  50,
+		HalvingInterval: 0,
+	}
+}
+
+func signedTx(t *testing.T, w *wallet.Wallet, recipient string, amount, nonce int) *Transaction {
+	t.Helper()
+	tx := &Transaction{Sender: w.Address, Recipient: recipient, Amount: amount, Nonce: nonce}
+	if err := tx.Sign(w); err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	return tx
+}
+
+// NewTransaction は送金者が持つ確定済み残高までしか送金を許さず、同じ残高を使い回して
+// 未承認のまま二重に送金しようとするとエラーになる
+func TestNewTransactionRejectsDoubleSpendAgainstPendingBalance(t *testing.T) {
+	store := NewMemoryStore()
+	bc, err := InitBlockchain(store, testBlockchainConfig())
+	if err != nil {
+		t.Fatalf("InitBlockchain returned error: %v", err)
+	}
+
+	alice, err := wallet.New()
+	if err != nil {
+		t.Fatalf("wallet.New returned error: %v", err)
+	}
+
+	if _, err := bc.NewCoinbaseTransaction(alice.Address, 50); err != nil {
+		t.Fatalf("NewCoinbaseTransaction returned error: %v", err)
+	}
+	if _, err := bc.NewBlock(ProofOfWork(bc.LastBlock().Proof, bc.CurrentDifficulty()), ""); err != nil {
+		t.Fatalf("NewBlock returned error: %v", err)
+	}
+	if got := bc.Balance(alice.Address); got != 50 {
+		t.Fatalf("expected alice's confirmed balance to be 50, got %d", got)
+	}
+
+	first := signedTx(t, alice, "bob", 50, 0)
+	if _, err := bc.NewTransaction(first); err != nil {
+		t.Fatalf("expected the first spend of alice's balance to succeed, got error: %v", err)
+	}
+
+	second := signedTx(t, alice, "carol", 50, 1)
+	if _, err := bc.NewTransaction(second); err != ErrInsufficientBalance {
+		t.Fatalf("expected ErrInsufficientBalance for a second spend against the same pending balance, got %v", err)
+	}
+}
+
+// NewTransaction は一度見たトランザクションIDの再提出を拒否する
+func TestNewTransactionRejectsDuplicateSubmission(t *testing.T) {
+	store := NewMemoryStore()
+	bc, err := InitBlockchain(store, testBlockchainConfig())
+	if err != nil {
+		t.Fatalf("InitBlockchain returned error: %v", err)
+	}
+
+	alice, err := wallet.New()
+	if err != nil {
+		t.Fatalf("wallet.New returned error: %v", err)
+	}
+	if _, err := bc.NewCoinbaseTransaction(alice.Address, 50); err != nil {
+		t.Fatalf("NewCoinbaseTransaction returned error: %v", err)
+	}
+	if _, err := bc.NewBlock(ProofOfWork(bc.LastBlock().Proof, bc.CurrentDifficulty()), ""); err != nil {
+		t.Fatalf("NewBlock returned error: %v", err)
+	}
+
+	tx := signedTx(t, alice, "bob", 10, 0)
+	if _, err := bc.NewTransaction(tx); err != nil {
+		t.Fatalf("expected first submission to succeed, got error: %v", err)
+	}
+	if _, err := bc.NewTransaction(tx); err != ErrDuplicateTransaction {
+		t.Fatalf("expected ErrDuplicateTransaction for a resubmitted transaction, got %v", err)
+	}
+}
+
+// NewBlock で採掘されたブロックのトランザクションは balances に反映され、mempool からは取り除かれる
+func TestNewBlockAppliesBalancesAndClearsMempool(t *testing.T) {
+	store := NewMemoryStore()
+	bc, err := InitBlockchain(store, testBlockchainConfig())
+	if err != nil {
+		t.Fatalf("InitBlockchain returned error: %v", err)
+	}
+
+	alice, err := wallet.New()
+	if err != nil {
+		t.Fatalf("wallet.New returned error: %v", err)
+	}
+	if _, err := bc.NewCoinbaseTransaction(alice.Address, 50); err != nil {
+		t.Fatalf("NewCoinbaseTransaction returned error: %v", err)
+	}
+	if _, err := bc.NewBlock(ProofOfWork(bc.LastBlock().Proof, bc.CurrentDifficulty()), ""); err != nil {
+		t.Fatalf("NewBlock returned error: %v", err)
+	}
+
+	tx := signedTx(t, alice, "bob", 20, 0)
+	if _, err := bc.NewTransaction(tx); err != nil {
+		t.Fatalf("NewTransaction returned error: %v", err)
+	}
+	if _, err := bc.NewBlock(ProofOfWork(bc.LastBlock().Proof, bc.CurrentDifficulty()), ""); err != nil {
+		t.Fatalf("NewBlock returned error: %v", err)
+	}
+
+	if got := bc.Balance(alice.Address); got != 30 {
+		t.Fatalf("expected alice's balance to be 30 after spending 20 of 50, got %d", got)
+	}
+	if got := bc.Balance("bob"); got != 20 {
+		t.Fatalf("expected bob's balance to be 20, got %d", got)
+	}
+	if len(bc.Mempool()) != 0 {
+		t.Fatalf("expected mempool to be empty after mining, got %d pending transactions", len(bc.Mempool()))
+	}
+}
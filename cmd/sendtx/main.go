@@ -0,0 +1,83 @@
+// sendtx は秘密鍵でトランザクションに署名し、/transactions/new にPOSTするCLIヘルパー
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/kawabatas/dvf-blockchain-go/wallet"
+)
+
+const (
+	ExitOK    = 0
+	ExitError = 1
+)
+
+type transactionRequest struct {
+	Sender    string `json:"sender"`
+	Recipient string `json:"recipient"`
+	Amount    int    `json:"amount"`
+	Nonce     int    `json:"nonce"`
+	Signature string `json:"signature,omitempty"`
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	addr := flag.String("addr", "http://localhost:5000", "接続先ノードのアドレス")
+	privateKey := flag.String("private-key", "", "送信者の秘密鍵（16進数）")
+	recipient := flag.String("recipient", "", "受信者のアドレス")
+	amount := flag.Int("amount", 0, "送金する量")
+	nonce := flag.Int("nonce", 0, "トランザクションのnonce")
+	flag.Parse()
+
+	if *privateKey == "" || *recipient == "" {
+		fmt.Fprintln(os.Stderr, "-private-key と -recipient は必須です")
+		return ExitError
+	}
+
+	w, err := wallet.FromPrivateKeyHex(*privateKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+
+	tx := &transactionRequest{
+		Sender:    w.Address,
+		Recipient: *recipient,
+		Amount:    *amount,
+		Nonce:     *nonce,
+	}
+
+	hash := wallet.PayloadHash(tx.Sender, tx.Recipient, tx.Amount, tx.Nonce)
+	sig, err := w.Sign(hash[:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	tx.Signature = sig
+	tx.PublicKey = w.PublicKeyHex()
+
+	body, err := json.Marshal(tx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+
+	resp, err := http.Post(*addr+"/transactions/new", "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	defer resp.Body.Close()
+
+	fmt.Println(resp.Status)
+	return ExitOK
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/bits"
+	"time"
+)
+
+const (
+	// initialDifficulty はジェネシスブロック時点でのプルーフ・オブ・ワークの難易度（先頭ゼロビット数）
+	// 元の「ハッシュの先頭が16進数で0000」という条件と同じ16ビットにしている
+	initialDifficulty = 16
+
+	// retargetInterval はこの数のブロックが採掘されるたびに難易度を再計算する間隔
+	retargetInterval = 10
+)
+
+// ProofOfWork は hash(lastProof, proof) の先頭ゼロビット数が difficulty 以上になる proof を探す
+// @param lastProof: 前のブロックのプルーフ
+// @param difficulty: 要求される先頭ゼロビット数
+// @return: プルーフ
+func ProofOfWork(lastProof, difficulty int) int {
+	proof := 0
+	for !ValidProof(lastProof, proof, difficulty) {
+		proof += 1
+	}
+	return proof
+}
+
+// ValidProof はプルーフが正しいかを確認する
+// hash(lastProof, proof) の生のSHA-256バイト列の先頭ゼロビット数が difficulty 以上であるかを見る
+// @param lastProof: 前のプルーフ
+// @param proof: 現在のプルーフ
+// @param difficulty: 要求される先頭ゼロビット数
+// @return: 正しければ true、そうでなければ false
+func ValidProof(lastProof, proof, difficulty int) bool {
+	guess := fmt.Sprintf("%d%d", lastProof, proof)
+	guessHash := sha256.Sum256([]byte(guess))
+	return leadingZeroBits(guessHash[:]) >= difficulty
+}
+
+// leadingZeroBits はバイト列の先頭から連続するゼロビットの数を数える
+func leadingZeroBits(hash []byte) int {
+	count := 0
+	for _, b := range hash {
+		if b == 0 {
+			count += 8
+			continue
+		}
+		count += bits.LeadingZeros8(b)
+		break
+	}
+	return count
+}
+
+// computeDifficulty は chain の状態から、次に採掘されるブロックに要求される難易度を導く
+//
+// retargetInterval ブロックごとに、直近のウィンドウの平均ブロック生成時間を targetBlockTime と比較して
+// 難易度を1段階だけ上下させる。リターゲット境界でなければ直前のブロックの難易度を引き継ぐ
+func computeDifficulty(chain []*Block, targetBlockTime time.Duration) int {
+	n := len(chain)
+	if n == 0 {
+		return initialDifficulty
+	}
+
+	last := chain[n-1]
+	if n < retargetInterval || n%retargetInterval != 0 {
+		return last.Difficulty
+	}
+
+	first := chain[n-retargetInterval]
+	actual := last.Timestamp.Sub(first.Timestamp)
+	expected := targetBlockTime * time.Duration(retargetInterval)
+
+	difficulty := last.Difficulty
+	switch {
+	case actual < expected/2:
+		difficulty++
+	case actual > expected*2 && difficulty > 1:
+		difficulty--
+	}
+	return difficulty
+}
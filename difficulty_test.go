@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidProof(t *testing.T) {
+	proof := ProofOfWork(100, 8)
+	if !ValidProof(100, proof, 8) {
+		t.Fatalf("ProofOfWork returned a proof that ValidProof rejects: %d", proof)
+	}
+	if ValidProof(100, proof+1, 24) {
+		t.Fatal("expected an arbitrary proof to fail a much higher difficulty")
+	}
+}
+
+func chainWithDifficulty(n int, difficulty int, blockTime time.Duration) []*Block {
+	chain := make([]*Block, n)
+	start := time.Unix(0, 0)
+	for i := range chain {
+		chain[i] = &Block{
+			Index:      i + 1,
+			Timestamp:  start.Add(time.Duration(i) * blockTime),
+			Difficulty: difficulty,
+		}
+	}
+	return chain
+}
+
+// リターゲット境界（chain の長さが retargetInterval の倍数）でなければ、直前のブロックの
+// 難易度をそのまま引き継ぐ
+func TestComputeDifficultyNotAtRetargetBoundary(t *testing.T) {
+	chain := chainWithDifficulty(retargetInterval+1, 16, time.Second)
+	got := computeDifficulty(chain, time.Second)
+	if got != 16 {
+		t.Fatalf("expected difficulty to carry over away from a retarget boundary, got %d", got)
+	}
+}
+
+// ブロックが目標より速く採掘されていれば、リターゲット境界で難易度を上げる
+func TestComputeDifficultyRetargetsUpWhenFast(t *testing.T) {
+	chain := chainWithDifficulty(retargetInterval, 16, time.Millisecond)
+	got := computeDifficulty(chain, time.Second)
+	if got != 17 {
+		t.Fatalf("expected difficulty to increase at a fast retarget boundary, got %d", got)
+	}
+}
+
+// ブロックが目標より遅く採掘されていれば、リターゲット境界で難易度を下げる
+func TestComputeDifficultyRetargetsDownWhenSlow(t *testing.T) {
+	chain := chainWithDifficulty(retargetInterval, 16, time.Hour)
+	got := computeDifficulty(chain, time.Second)
+	if got != 15 {
+		t.Fatalf("expected difficulty to decrease at a slow retarget boundary, got %d", got)
+	}
+}
+
+// 難易度は1より下がらない
+func TestComputeDifficultyNeverDropsBelowOne(t *testing.T) {
+	chain := chainWithDifficulty(retargetInterval, 1, time.Hour)
+	got := computeDifficulty(chain, time.Second)
+	if got != 1 {
+		t.Fatalf("expected difficulty to stay at the floor of 1, got %d", got)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// broadcastTransaction は tx を最大 gossipFanout 件のピアへ /transactions/receive 経由で非同期に送信する
+func (s *Server) broadcastTransaction(tx *Transaction) {
+	s.broadcast("/transactions/receive", tx)
+}
+
+// broadcastBlock は b を最大 gossipFanout 件のピアへ /blocks/receive 経由で非同期に送信する
+func (s *Server) broadcastBlock(b *Block) {
+	s.broadcast("/blocks/receive", b)
+}
+
+// broadcast は payload を bc.Nodes のうち最大 gossipFanout 件のピアへ並行に送信する
+//
+// 各送信は gossipBackoff でタイムアウトし、応答のない遅いピアが他のピアへの送信や
+// 採掘をブロックしないようにする
+func (s *Server) broadcast(path string, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	peers := make([]string, 0, len(s.blockchain.Nodes))
+	for node := range s.blockchain.Nodes {
+		peers = append(peers, node)
+	}
+
+	fanout := s.blockchain.gossipFanout
+	if fanout <= 0 || fanout > len(peers) {
+		fanout = len(peers)
+	}
+
+	client := &http.Client{Timeout: s.blockchain.gossipBackoff}
+	for _, node := range peers[:fanout] {
+		go func(node string) {
+			resp, err := client.Post(node+path, "application/json", bytes.NewReader(body))
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+		}(node)
+	}
+}
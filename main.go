@@ -8,6 +8,7 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -20,11 +21,25 @@ const (
 func main() {
 	// port5000でサーバーを起動する
 	flagAddr := flag.String("addr", ":5000", "host:port")
+	flagDB := flag.String("db", "dvf-blockchain.db", "path to the BoltDB file used for persistence")
+	flagTargetBlockTime := flag.Duration("target-block-time", 10*time.Second, "target time between blocks used for difficulty retargeting")
+	flagGossipFanout := flag.Int("gossip-fanout", 8, "max number of peers a transaction or block is gossiped to at once")
+	flagGossipBackoff := flag.Duration("gossip-backoff", 2*time.Second, "timeout before giving up on a slow peer during gossip")
+	flagCoinbaseReward := flag.Int("coinbase-reward", 50, "mining reward paid out before halving is applied")
+	flagHalvingInterval := flag.Int("halving-interval", 210000, "number of blocks mined between each halving of the coinbase reward")
 	flag.Parse()
-	os.Exit(run(*flagAddr))
+
+	cfg := BlockchainConfig{
+		TargetBlockTime: *flagTargetBlockTime,
+		GossipFanout:    *flagGossipFanout,
+		GossipBackoff:   *flagGossipBackoff,
+		CoinbaseReward:  *flagCoinbaseReward,
+		HalvingInterval: *flagHalvingInterval,
+	}
+	os.Exit(run(*flagAddr, *flagDB, cfg))
 }
 
-func run(addr string) int {
+func run(addr, dbPath string, cfg BlockchainConfig) int {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
@@ -38,8 +53,16 @@ func run(addr string) int {
 	}
 	nodeIdentifier := strings.Replace(nodeUuid.String(), "-", "", -1)
 
+	// 永続化ストアを開く
+	store, err := NewBoltStore(dbPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	defer store.Close()
+
 	// ブロックチェーンクラスをインスタンス化する
-	blockchain, err := InitBlockchain()
+	blockchain, err := InitBlockchain(store, cfg)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return ExitError
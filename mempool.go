@@ -0,0 +1,27 @@
+package main
+
+import "sync"
+
+// seenCache はトランザクションIDなど文字列キーの既知集合を保持する
+//
+// ゴシップで受け取ったメッセージを再度ブロードキャストする前に重複排除し、
+// 伝播がループし続けるのを防ぐために使う
+type seenCache struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newSeenCache() *seenCache {
+	return &seenCache{seen: make(map[string]bool)}
+}
+
+// markSeen は id を既知として記録する。既に記録済みであれば false を返す
+func (c *seenCache) markSeen(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen[id] {
+		return false
+	}
+	c.seen[id] = true
+	return true
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+)
+
+// ErrMalformedMerkleProof は MerkleProof の Siblings と IsLeft の長さが一致しない場合に返される
+var ErrMalformedMerkleProof = errors.New("merkle: malformed proof")
+
+// ErrInvalidSiblingHash はプルーフに含まれるシブリングハッシュをデコードした結果が32バイトでない場合に返される
+// 16進文字列としてデコードできない場合は、デコード時のエラーがそのまま返される
+var ErrInvalidSiblingHash = errors.New("merkle: invalid sibling hash")
+
+// emptyMerkleRoot はトランザクションが1つもないブロックのマークルルート
+var emptyMerkleRoot = sha256.Sum256(nil)
+
+// MerkleProof はあるトランザクションがマークルルートに含まれることを示す証明
+//
+// 葉からルートに向かって、各階層のシブリングハッシュと、対象のノードが左側の子か右側の子かを保持する
+type MerkleProof struct {
+	Siblings []string `json:"siblings"`
+	IsLeft   []bool   `json:"is_left"`
+}
+
+// transactionHash はトランザクションの正規のエンコード（JSON）のSHA-256ハッシュを返す
+func transactionHash(tx *Transaction) ([32]byte, error) {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// TxID はトランザクションのハッシュを16進文字列にしたもの
+func TxID(tx *Transaction) (string, error) {
+	hash, err := transactionHash(tx)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// merkleLeaves はトランザクションの葉ハッシュの列を返す
+func merkleLeaves(txs []*Transaction) ([][32]byte, error) {
+	leaves := make([][32]byte, len(txs))
+	for i, tx := range txs {
+		hash, err := transactionHash(tx)
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = hash
+	}
+	return leaves, nil
+}
+
+// MerkleRoot は txs の標準的なバイナリ・マークルツリーのルートハッシュを16進文字列で返す
+//
+// 各階層の要素数が奇数の場合は最後の葉を複製して偶数にそろえる
+func MerkleRoot(txs []*Transaction) (string, error) {
+	if len(txs) == 0 {
+		return hex.EncodeToString(emptyMerkleRoot[:]), nil
+	}
+
+	level, err := merkleLeaves(txs)
+	if err != nil {
+		return "", err
+	}
+	for len(level) > 1 {
+		level = merkleNextLevel(level)
+	}
+	return hex.EncodeToString(level[0][:]), nil
+}
+
+// merkleNextLevel は1階層分のハッシュを2つずつ連結してハッシュ化し、1つ上の階層を作る
+func merkleNextLevel(level [][32]byte) [][32]byte {
+	if len(level)%2 == 1 {
+		level = append(level, level[len(level)-1])
+	}
+	next := make([][32]byte, 0, len(level)/2)
+	for i := 0; i < len(level); i += 2 {
+		concat := append(append([]byte{}, level[i][:]...), level[i+1][:]...)
+		next = append(next, sha256.Sum256(concat))
+	}
+	return next
+}
+
+// merkleProof は txs のうち index 番目のトランザクションについて MerkleProof を組み立てる
+func merkleProof(txs []*Transaction, index int) (*MerkleProof, error) {
+	level, err := merkleLeaves(txs)
+	if err != nil {
+		return nil, err
+	}
+
+	proof := &MerkleProof{}
+	idx := index
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+
+		var siblingIndex int
+		var isLeft bool
+		if idx%2 == 0 {
+			siblingIndex = idx + 1
+			isLeft = true
+		} else {
+			siblingIndex = idx - 1
+			isLeft = false
+		}
+		proof.Siblings = append(proof.Siblings, hex.EncodeToString(level[siblingIndex][:]))
+		proof.IsLeft = append(proof.IsLeft, isLeft)
+
+		level = merkleNextLevel(level)
+		idx = idx / 2
+	}
+	return proof, nil
+}
+
+// VerifyMerkleProof は、軽量クライアントが tx・proof・root だけからトランザクションの
+// 帰属を検証するためのヘルパー
+// @param tx: 検証したいトランザクション
+// @param proof: merkleProof で組み立てられた証明
+// @param root: ブロックの MerkleRoot（16進文字列）
+// @return: tx が root に属していれば true
+// @return: エラー
+func VerifyMerkleProof(tx *Transaction, proof *MerkleProof, root string) (bool, error) {
+	if len(proof.Siblings) != len(proof.IsLeft) {
+		return false, ErrMalformedMerkleProof
+	}
+
+	current, err := transactionHash(tx)
+	if err != nil {
+		return false, err
+	}
+
+	for i, siblingHex := range proof.Siblings {
+		sibling, err := hex.DecodeString(siblingHex)
+		if err != nil {
+			return false, err
+		}
+		if len(sibling) != sha256.Size {
+			return false, ErrInvalidSiblingHash
+		}
+
+		var concat []byte
+		if proof.IsLeft[i] {
+			concat = append(append([]byte{}, current[:]...), sibling...)
+		} else {
+			concat = append(append([]byte{}, sibling...), current[:]...)
+		}
+		current = sha256.Sum256(concat)
+	}
+
+	return hex.EncodeToString(current[:]) == root, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+func txsForMerkleTest(n int) []*Transaction {
+	txs := make([]*Transaction, n)
+	for i := range txs {
+		txs[i] = &Transaction{
+			Sender:    "alice",
+			Recipient: "bob",
+			Amount:    i + 1,
+			Nonce:     i,
+		}
+	}
+	return txs
+}
+
+// MerkleRoot と merkleProof/VerifyMerkleProof が、偶数・奇数いずれのトランザクション数でも
+// 一貫した往復（root を計算 → 各葉の proof を作る → 同じ root に対して検証できる）になることを確認する
+func TestMerkleRoundTrip(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 4, 5, 7, 8} {
+		txs := txsForMerkleTest(n)
+
+		root, err := MerkleRoot(txs)
+		if err != nil {
+			t.Fatalf("n=%d: MerkleRoot returned error: %v", n, err)
+		}
+
+		for i, tx := range txs {
+			proof, err := merkleProof(txs, i)
+			if err != nil {
+				t.Fatalf("n=%d index=%d: merkleProof returned error: %v", n, i, err)
+			}
+			ok, err := VerifyMerkleProof(tx, proof, root)
+			if err != nil {
+				t.Fatalf("n=%d index=%d: VerifyMerkleProof returned error: %v", n, i, err)
+			}
+			if !ok {
+				t.Errorf("n=%d index=%d: expected proof to verify against root", n, i)
+			}
+		}
+	}
+}
+
+func TestMerkleRootEmpty(t *testing.T) {
+	root, err := MerkleRoot(nil)
+	if err != nil {
+		t.Fatalf("MerkleRoot returned error: %v", err)
+	}
+	if root == "" {
+		t.Fatal("expected a non-empty root for an empty transaction list")
+	}
+}
+
+func TestVerifyMerkleProofRejectsWrongTransaction(t *testing.T) {
+	txs := txsForMerkleTest(3)
+	root, err := MerkleRoot(txs)
+	if err != nil {
+		t.Fatalf("MerkleRoot returned error: %v", err)
+	}
+	proof, err := merkleProof(txs, 0)
+	if err != nil {
+		t.Fatalf("merkleProof returned error: %v", err)
+	}
+
+	other := &Transaction{Sender: "mallory", Recipient: "bob", Amount: 999, Nonce: 0}
+	ok, err := VerifyMerkleProof(other, proof, root)
+	if err != nil {
+		t.Fatalf("VerifyMerkleProof returned error: %v", err)
+	}
+	if ok {
+		t.Fatal("expected proof for a different transaction to fail verification")
+	}
+}
@@ -6,6 +6,10 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kawabatas/dvf-blockchain-go/wallet"
 )
 
 type Server struct {
@@ -45,14 +49,30 @@ func (s *Server) initHandlers() {
 
 	// メソッドはPOSTで/transactions/newエンドポイントを作る。メソッドはPOSTなのでデータを送信する
 	mux.HandleFunc("/transactions/new", s.HandleNewTransactions)
+	// メソッドはPOSTで、ピアから送られてきたトランザクションを受け取る/transactions/receiveエンドポイントを作る
+	mux.HandleFunc("/transactions/receive", s.HandleTransactionReceive)
 	// メソッドはGETで/mineエンドポイントを作る
 	mux.HandleFunc("/mine", s.HandleMine)
+	// メソッドはPOSTで、ピアから送られてきたブロックを受け取る/blocks/receiveエンドポイントを作る
+	mux.HandleFunc("/blocks/receive", s.HandleBlockReceive)
 	// メソッドはGETで、フルのブロックチェーンをリターンする/chainエンドポイントを作る
 	mux.HandleFunc("/chain", s.HandleFullChain)
 	// URLの形での新しいノードのリストを受け取る
 	mux.HandleFunc("/nodes/register", s.HandleRegisterNode)
 	// あらゆるコンフリクトを解消することで、ノードが正しいチェーンを持っていることを確認する
 	mux.HandleFunc("/nodes/resolve", s.HandleConsensus)
+	// メソッドはGETで、インデックスを指定してブロックを1件だけ取得する/blocks/{index}エンドポイントを作る
+	mux.HandleFunc("/blocks/", s.HandleGetBlock)
+	// メソッドはGETで、新しいウォレット（鍵ペアとアドレス）を作る/wallet/newエンドポイントを作る
+	mux.HandleFunc("/wallet/new", s.HandleNewWallet)
+	// メソッドはGETで、現在のプルーフ・オブ・ワーク難易度を返す/difficultyエンドポイントを作る
+	mux.HandleFunc("/difficulty", s.HandleDifficulty)
+	// メソッドはGETで、トランザクションがマークルルートに属することを示す証明を返す/transactions/{txid}/proofエンドポイントを作る
+	mux.HandleFunc("/transactions/", s.HandleTransactionProof)
+	// メソッドはGETで、アドレスを指定して残高を取得する/balance/{address}エンドポイントを作る
+	mux.HandleFunc("/balance/", s.HandleBalance)
+	// メソッドはGETで、未承認のトランザクション一覧を返す/mempoolエンドポイントを作る
+	mux.HandleFunc("/mempool", s.HandleMempool)
 }
 
 type NewTransactionsResponse struct {
@@ -73,7 +93,18 @@ func (s *Server) HandleNewTransactions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 新しいトランザクションを作る
-	index := s.blockchain.NewTransaction(transaction.Sender, transaction.Recipient, transaction.Amount)
+	index, err := s.blockchain.NewTransaction(&transaction)
+	if err == ErrInvalidSignature || err == ErrDuplicateTransaction || err == ErrInsufficientBalance || err == ErrInvalidAmount || err == ErrInvalidSender {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// 採掘を待たせないよう、ピアへは非同期に伝播する
+	s.broadcastTransaction(&transaction)
 
 	if err := json.NewEncoder(w).Encode(&NewTransactionsResponse{
 		Message: fmt.Sprintf("トランザクションはブロック %d に追加されました", index),
@@ -94,15 +125,14 @@ type MineResponse struct {
 func (s *Server) HandleMine(w http.ResponseWriter, r *http.Request) {
 	// 次のプルーフを見つけるためプルーフ・オブ・ワークアルゴリズムを使用する
 	lastBlock := s.blockchain.LastBlock()
-	proof := ProofOfWork(lastBlock.Proof)
+	proof := ProofOfWork(lastBlock.Proof, s.blockchain.CurrentDifficulty())
 
 	// プルーフを見つけたことに対する報酬を得る
 	// 送信者は、採掘者が新しいコインを採掘したことを表すために"0"とする
-	s.blockchain.NewTransaction(
-		"0",
-		s.nodeIdentifier,
-		1,
-	)
+	if _, err := s.blockchain.NewCoinbaseTransaction(s.nodeIdentifier, s.blockchain.CoinbaseReward()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	// チェーンに新しいブロックを加えることで、新しいブロックを採掘する
 	block, err := s.blockchain.NewBlock(proof, "")
@@ -111,6 +141,9 @@ func (s *Server) HandleMine(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 採掘を待たせないよう、ピアへは非同期に伝播する
+	s.broadcastBlock(block)
+
 	if err := json.NewEncoder(w).Encode(&MineResponse{
 		Message:      "新しいブロックを採掘しました",
 		Index:        block.Index,
@@ -129,9 +162,10 @@ type FullChainResponse struct {
 }
 
 func (s *Server) HandleFullChain(w http.ResponseWriter, r *http.Request) {
+	chain := s.blockchain.ChainSnapshot()
 	if err := json.NewEncoder(w).Encode(&FullChainResponse{
-		Chain:  s.blockchain.Chain,
-		Length: len(s.blockchain.Chain),
+		Chain:  chain,
+		Length: len(chain),
 	}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -163,7 +197,10 @@ func (s *Server) HandleRegisterNode(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, node := range body.Nodes {
-		s.blockchain.RegisterNode(node)
+		if err := s.blockchain.RegisterNode(node); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
 	var totalNodes []string
@@ -197,12 +234,12 @@ func (s *Server) HandleConsensus(w http.ResponseWriter, r *http.Request) {
 	if replaced {
 		resp = &ConsensusResponse{
 			Message: "チェーンが置き換えられました",
-			Chain:   s.blockchain.Chain,
+			Chain:   s.blockchain.ChainSnapshot(),
 		}
 	} else {
 		resp = &ConsensusResponse{
 			Message: "チェーンが確認されました",
-			Chain:   s.blockchain.Chain,
+			Chain:   s.blockchain.ChainSnapshot(),
 		}
 	}
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -210,3 +247,201 @@ func (s *Server) HandleConsensus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func (s *Server) HandleGetBlock(w http.ResponseWriter, r *http.Request) {
+	indexStr := strings.TrimPrefix(r.URL.Path, "/blocks/")
+	index, err := strconv.Atoi(indexStr)
+	if err != nil {
+		http.Error(w, "無効なブロック番号です", http.StatusBadRequest)
+		return
+	}
+
+	block, err := s.blockchain.GetBlock(index)
+	if err == ErrBlockNotFound {
+		http.Error(w, "ブロックが見つかりません", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(block); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type NewWalletResponse struct {
+	Address    string `json:"address"`
+	PrivateKey string `json:"private_key"`
+	PublicKey  string `json:"public_key"`
+}
+
+func (s *Server) HandleNewWallet(w http.ResponseWriter, r *http.Request) {
+	wlt, err := wallet.New()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&NewWalletResponse{
+		Address:    wlt.Address,
+		PrivateKey: wlt.PrivateKeyHex(),
+		PublicKey:  wlt.PublicKeyHex(),
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type DifficultyResponse struct {
+	Difficulty          int `json:"difficulty"`
+	BlocksUntilRetarget int `json:"blocks_until_retarget"`
+}
+
+func (s *Server) HandleDifficulty(w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(&DifficultyResponse{
+		Difficulty:          s.blockchain.CurrentDifficulty(),
+		BlocksUntilRetarget: s.blockchain.BlocksUntilRetarget(),
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type TransactionProofResponse struct {
+	BlockIndex int          `json:"block_index"`
+	MerkleRoot string       `json:"merkle_root"`
+	Proof      *MerkleProof `json:"proof"`
+}
+
+func (s *Server) HandleTransactionProof(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/transactions/")
+	if !strings.HasSuffix(path, "/proof") {
+		http.NotFound(w, r)
+		return
+	}
+	txid := strings.TrimSuffix(path, "/proof")
+
+	for _, block := range s.blockchain.ChainSnapshot() {
+		for i, tx := range block.Transactions {
+			id, err := TxID(tx)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if id != txid {
+				continue
+			}
+
+			proof, err := merkleProof(block.Transactions, i)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := json.NewEncoder(w).Encode(&TransactionProofResponse{
+				BlockIndex: block.Index,
+				MerkleRoot: block.MerkleRoot,
+				Proof:      proof,
+			}); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			return
+		}
+	}
+
+	http.Error(w, "トランザクションが見つかりません", http.StatusNotFound)
+}
+
+func (s *Server) HandleTransactionReceive(w http.ResponseWriter, r *http.Request) {
+	var transaction Transaction
+	if err := json.NewDecoder(r.Body).Decode(&transaction); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err := s.blockchain.NewTransaction(&transaction)
+	if err == ErrDuplicateTransaction {
+		// 既に知っているトランザクションなので何もしない
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err == ErrInvalidSignature || err == ErrInsufficientBalance || err == ErrInvalidAmount || err == ErrInvalidSender {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// 受け取ったトランザクションを一度だけ再ブロードキャストする
+	s.broadcastTransaction(&transaction)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+type BalanceResponse struct {
+	Address   string `json:"address"`
+	Balance   int    `json:"balance"`
+	Available int    `json:"available"`
+}
+
+func (s *Server) HandleBalance(w http.ResponseWriter, r *http.Request) {
+	address := strings.TrimPrefix(r.URL.Path, "/balance/")
+	if address == "" {
+		http.Error(w, "アドレスを指定してください", http.StatusBadRequest)
+		return
+	}
+
+	balance := s.blockchain.Balance(address)
+	if err := json.NewEncoder(w).Encode(&BalanceResponse{
+		Address:   address,
+		Balance:   balance,
+		Available: balance - s.blockchain.PendingOutflow(address),
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type MempoolResponse struct {
+	Transactions []*Transaction `json:"transactions"`
+}
+
+func (s *Server) HandleMempool(w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(&MempoolResponse{
+		Transactions: s.blockchain.Mempool(),
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) HandleBlockReceive(w http.ResponseWriter, r *http.Request) {
+	var block Block
+	if err := json.NewDecoder(r.Body).Decode(&block); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	outcome, err := s.blockchain.ReceiveBlock(&block)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch outcome {
+	case BlockAppended:
+		// 受け取ったブロックを一度だけ再ブロードキャストする
+		s.broadcastBlock(&block)
+	case BlockHeightMismatch:
+		// 自らのチェーンより高さが先に進んでいるので、コンフリクト解消に任せる
+		go s.blockchain.ResolveConflicts()
+	case BlockIgnored:
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,31 @@
+package main
+
+import "errors"
+
+// ErrBlockNotFound はインデックスに対応するブロックが見つからない場合に返される
+var ErrBlockNotFound = errors.New("store: block not found")
+
+// Store はブロックチェーンの状態を永続化するためのインターフェース
+//
+// ノードを再起動してもチェーン・未承認トランザクション・既知のノード一覧が
+// 失われないように、バックエンド（BoltDBやインメモリなど）を差し替え可能にする
+type Store interface {
+	// PutBlock はブロックを永続化する
+	PutBlock(b *Block) error
+	// GetBlock はインデックスを指定してブロックを1件だけ取得する。チェーン全体は読み込まない
+	GetBlock(index int) (*Block, error)
+	// IterateChain は永続化されているブロックをインデックスの昇順で fn に渡す
+	IterateChain(fn func(b *Block) error) error
+	// PutPendingTx は未承認トランザクションを永続化する
+	PutPendingTx(tx *Transaction) error
+	// PendingTxs は永続化されている未承認トランザクションを返す
+	PendingTxs() ([]*Transaction, error)
+	// ClearPendingTxs は永続化されている未承認トランザクションをすべて削除する
+	ClearPendingTxs() error
+	// PutNode はノードアドレスを永続化する
+	PutNode(address string) error
+	// Nodes は永続化されているノードアドレスの一覧を返す
+	Nodes() (map[string]bool, error)
+	// Close はストアが保持するリソースを解放する
+	Close() error
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	blocksBucket  = "blocks"
+	metaBucket    = "meta"
+	pendingBucket = "pending"
+	nodesBucket   = "nodes"
+	tipKey        = "tip"
+)
+
+// BoltStore は BoltDB をバックエンドとする Store の実装
+//
+// ブロックはインデックスをビッグエンディアンでエンコードしたキーで blocks バケットに保存し、
+// 最新ブロックのインデックスを meta バケットの tip キーに保持する
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore は path の BoltDB ファイルを開き、必要なバケットを作成する
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{blocksBucket, metaBucket, pendingBucket, nodesBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// indexKey はブロックのインデックスを blocks バケットのキーに変換する
+func indexKey(index int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(index))
+	return key
+}
+
+func (s *BoltStore) PutBlock(b *Block) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(blocksBucket)).Put(indexKey(b.Index), data); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(metaBucket)).Put([]byte(tipKey), indexKey(b.Index))
+	})
+}
+
+func (s *BoltStore) GetBlock(index int) (*Block, error) {
+	var b *Block
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(blocksBucket)).Get(indexKey(index))
+		if data == nil {
+			return ErrBlockNotFound
+		}
+		b = &Block{}
+		return json.Unmarshal(data, b)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *BoltStore) IterateChain(fn func(b *Block) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(blocksBucket)).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			b := &Block{}
+			if err := json.Unmarshal(v, b); err != nil {
+				return err
+			}
+			if err := fn(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) PutPendingTx(tx *Transaction) error {
+	return s.db.Update(func(btx *bolt.Tx) error {
+		bucket := btx.Bucket([]byte(pendingBucket))
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(indexKey(int(seq)), data)
+	})
+}
+
+func (s *BoltStore) PendingTxs() ([]*Transaction, error) {
+	var txs []*Transaction
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(pendingBucket)).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			t := &Transaction{}
+			if err := json.Unmarshal(v, t); err != nil {
+				return err
+			}
+			txs = append(txs, t)
+		}
+		return nil
+	})
+	return txs, err
+}
+
+func (s *BoltStore) ClearPendingTxs() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(pendingBucket)); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket([]byte(pendingBucket))
+		return err
+	})
+}
+
+func (s *BoltStore) PutNode(address string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(nodesBucket)).Put([]byte(address), []byte{1})
+	})
+}
+
+func (s *BoltStore) Nodes() (map[string]bool, error) {
+	nodes := make(map[string]bool)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(nodesBucket)).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			nodes[string(k)] = true
+		}
+		return nil
+	})
+	return nodes, err
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
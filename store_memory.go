@@ -0,0 +1,96 @@
+package main
+
+import "sync"
+
+// MemoryStore はプロセスのメモリ上にのみ状態を保持する Store の実装
+//
+// テストや使い捨ての実行など、永続化が不要な場面で BoltStore の代わりに利用する
+type MemoryStore struct {
+	mu      sync.Mutex
+	blocks  map[int]*Block
+	pending []*Transaction
+	nodes   map[string]bool
+}
+
+// NewMemoryStore は空の MemoryStore を作る
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		blocks: make(map[int]*Block),
+		nodes:  make(map[string]bool),
+	}
+}
+
+func (s *MemoryStore) PutBlock(b *Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocks[b.Index] = b
+	return nil
+}
+
+func (s *MemoryStore) GetBlock(index int) (*Block, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.blocks[index]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	return b, nil
+}
+
+func (s *MemoryStore) IterateChain(fn func(b *Block) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 1; i <= len(s.blocks); i++ {
+		b, ok := s.blocks[i]
+		if !ok {
+			break
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) PutPendingTx(tx *Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, tx)
+	return nil
+}
+
+func (s *MemoryStore) PendingTxs() ([]*Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]*Transaction, len(s.pending))
+	copy(out, s.pending)
+	return out, nil
+}
+
+func (s *MemoryStore) ClearPendingTxs() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = nil
+	return nil
+}
+
+func (s *MemoryStore) PutNode(address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes[address] = true
+	return nil
+}
+
+func (s *MemoryStore) Nodes() (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]bool, len(s.nodes))
+	for k, v := range s.nodes {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
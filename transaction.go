@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/kawabatas/dvf-blockchain-go/wallet"
+)
+
+// coinbaseSender は採掘報酬のトランザクションに使われる特別な送信者アドレス
+const coinbaseSender = "0"
+
+// ErrInvalidSignature はトランザクションの署名が検証に失敗した場合に返される
+var ErrInvalidSignature = errors.New("transaction: invalid signature")
+
+// ErrCoinbaseAlreadyPending は1ブロックにつき1つまでしか許されないコインベース報酬が
+// 既に未承認トランザクションに含まれている場合に返される
+var ErrCoinbaseAlreadyPending = errors.New("transaction: coinbase reward already pending")
+
+// ErrDuplicateTransaction はすでに見たことのあるトランザクションIDを持つトランザクションが
+// 提出された場合に返される
+var ErrDuplicateTransaction = errors.New("transaction: duplicate transaction")
+
+// ErrInsufficientBalance は Sender の残高（未承認の送金分を差し引いたもの）が
+// Amount に満たない場合に返される
+var ErrInsufficientBalance = errors.New("transaction: insufficient balance")
+
+// ErrInvalidAmount は Amount が0以下の場合に返される
+var ErrInvalidAmount = errors.New("transaction: amount must be positive")
+
+// ErrInvalidSender は外部から提出されたトランザクションの Sender が coinbaseSender だった場合に
+// 返される。コインベース報酬は採掘フローからのみ作られる
+var ErrInvalidSender = errors.New("transaction: sender not allowed")
+
+type Transaction struct {
+	Sender    string `json:"sender"`
+	Recipient string `json:"recipient"`
+	Amount    int    `json:"amount"`
+	Nonce     int    `json:"nonce"`
+	Signature string `json:"signature,omitempty"`
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+// Sign は w の秘密鍵で (Sender, Recipient, Amount, Nonce) に署名し、Signature と PublicKey を埋める
+func (tx *Transaction) Sign(w *wallet.Wallet) error {
+	hash := wallet.PayloadHash(tx.Sender, tx.Recipient, tx.Amount, tx.Nonce)
+	sig, err := w.Sign(hash[:])
+	if err != nil {
+		return err
+	}
+	tx.Signature = sig
+	tx.PublicKey = w.PublicKeyHex()
+	return nil
+}
+
+// Verify は署名が (Sender, Recipient, Amount, Nonce) のペイロードと Sender のアドレスに一致するかを確認する
+//
+// コインベース報酬（Sender が "0"）は署名検証の対象外
+func (tx *Transaction) Verify() (bool, error) {
+	if tx.Sender == coinbaseSender {
+		return true, nil
+	}
+
+	pub, err := wallet.PublicKeyFromHex(tx.PublicKey)
+	if err != nil {
+		return false, err
+	}
+	if wallet.AddressFromPublicKey(pub) != tx.Sender {
+		return false, nil
+	}
+
+	hash := wallet.PayloadHash(tx.Sender, tx.Recipient, tx.Amount, tx.Nonce)
+	return wallet.Verify(pub, tx.Signature, hash[:])
+}
+
+// validateBlockTransactions は txs の Amount がすべて正であり、署名がすべて正しく、
+// コインベース報酬が1つまでであることを確認する
+func validateBlockTransactions(txs []*Transaction) (bool, error) {
+	coinbaseCount := 0
+	for _, tx := range txs {
+		if tx.Amount <= 0 {
+			return false, nil
+		}
+		if tx.Sender == coinbaseSender {
+			coinbaseCount++
+			continue
+		}
+		ok, err := tx.Verify()
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return coinbaseCount <= 1, nil
+}
@@ -0,0 +1,143 @@
+// Package wallet は、アドレスの導出とトランザクションの署名・検証に使う
+// ECDSA（P-256）の鍵ペアを扱う
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrInvalidPublicKey は16進文字列が有効な公開鍵にデコードできない場合に返される
+var ErrInvalidPublicKey = errors.New("wallet: invalid public key")
+
+var curve = elliptic.P256()
+
+// keySize は P-256 の座標やスカラー値1つ分のバイト長
+const keySize = 32
+
+// Wallet はアドレスの元となる ECDSA の鍵ペアを保持する
+type Wallet struct {
+	PrivateKey *ecdsa.PrivateKey
+	Address    string
+}
+
+// New は新しい鍵ペアを生成し、公開鍵から導出したアドレスを持つ Wallet を作る
+func New() (*Wallet, error) {
+	priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{
+		PrivateKey: priv,
+		Address:    AddressFromPublicKey(&priv.PublicKey),
+	}, nil
+}
+
+// FromPrivateKeyHex は16進エンコードされた秘密鍵のスカラー値から Wallet を復元する
+func FromPrivateKeyHex(privHex string) (*Wallet, error) {
+	b, err := hex.DecodeString(privHex)
+	if err != nil {
+		return nil, err
+	}
+
+	priv := new(ecdsa.PrivateKey)
+	priv.PublicKey.Curve = curve
+	priv.D = new(big.Int).SetBytes(b)
+	priv.PublicKey.X, priv.PublicKey.Y = curve.ScalarBaseMult(b)
+
+	return &Wallet{
+		PrivateKey: priv,
+		Address:    AddressFromPublicKey(&priv.PublicKey),
+	}, nil
+}
+
+// AddressFromPublicKey は公開鍵の SHA-256 ハッシュをアドレスとして返す
+func AddressFromPublicKey(pub *ecdsa.PublicKey) string {
+	pubBytes := elliptic.Marshal(pub.Curve, pub.X, pub.Y)
+	hash := sha256.Sum256(pubBytes)
+	return hex.EncodeToString(hash[:])
+}
+
+// PublicKeyFromHex は16進エンコードされた公開鍵をデコードする
+func PublicKeyFromHex(pubHex string) (*ecdsa.PublicKey, error) {
+	pubBytes, err := hex.DecodeString(pubHex)
+	if err != nil {
+		return nil, err
+	}
+	x, y := elliptic.Unmarshal(curve, pubBytes)
+	if x == nil {
+		return nil, ErrInvalidPublicKey
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// PayloadHash は (sender, recipient, amount, nonce) を正規の形式で連結しハッシュ化する
+//
+// 署名・検証の両方がこのハッシュを対象とする
+func PayloadHash(sender, recipient string, amount, nonce int) [32]byte {
+	payload := fmt.Sprintf("%s|%s|%d|%d", sender, recipient, amount, nonce)
+	return sha256.Sum256([]byte(payload))
+}
+
+// PrivateKeyHex は秘密鍵のスカラー値を16進エンコードして返す
+func (w *Wallet) PrivateKeyHex() string {
+	return hex.EncodeToString(pad(w.PrivateKey.D))
+}
+
+// PublicKeyHex は公開鍵を16進エンコードして返す
+func (w *Wallet) PublicKeyHex() string {
+	return hex.EncodeToString(elliptic.Marshal(w.PrivateKey.Curve, w.PrivateKey.X, w.PrivateKey.Y))
+}
+
+// Sign は hash に対する ECDSA 署名を作り、16進エンコードして返す
+//
+// s が halfOrder を超える場合は N-s に正規化し、常に低S値の署名を返す
+func (w *Wallet) Sign(hash []byte) (string, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, w.PrivateKey, hash)
+	if err != nil {
+		return "", err
+	}
+	if s.Cmp(halfOrder) > 0 {
+		s = new(big.Int).Sub(curve.Params().N, s)
+	}
+	sig := append(pad(r), pad(s)...)
+	return hex.EncodeToString(sig), nil
+}
+
+// halfOrder は曲線の位数の半分。s がこれを超える署名は高S値（低S値のもう一方の有効な署名）であり、
+// 同じペイロードに対する署名を可鍛性なく一意にするため拒否する
+var halfOrder = new(big.Int).Rsh(curve.Params().N, 1)
+
+// Verify は16進エンコードされた署名を pub と hash に対して検証する
+//
+// (r, s) と (r, N-s) はどちらも同じペイロードに対して有効な ECDSA 署名になるため（署名の可鍛性）、
+// s が halfOrder を超える高S値の署名は拒否し、TxID によるトランザクションの一意性を保証する
+func Verify(pub *ecdsa.PublicKey, sigHex string, hash []byte) (bool, error) {
+	sig, err := hex.DecodeString(sigHex)
+	if err != nil {
+		return false, err
+	}
+	if len(sig) != keySize*2 {
+		return false, nil
+	}
+	r := new(big.Int).SetBytes(sig[:keySize])
+	s := new(big.Int).SetBytes(sig[keySize:])
+	if s.Cmp(halfOrder) > 0 {
+		return false, nil
+	}
+	return ecdsa.Verify(pub, hash, r, s), nil
+}
+
+// pad は big.Int をちょうど keySize バイトになるようゼロ埋めする
+func pad(n *big.Int) []byte {
+	b := n.Bytes()
+	buf := make([]byte, keySize)
+	copy(buf[keySize-len(b):], b)
+	return buf
+}
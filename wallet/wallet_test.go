@@ -0,0 +1,82 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	w, err := New()
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	hash := PayloadHash(w.Address, "bob", 10, 0)
+
+	sigHex, err := w.Sign(hash[:])
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+
+	ok, err := Verify(&w.PrivateKey.PublicKey, sigHex, hash[:])
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if !ok {
+		t.Fatal("expected signature to verify")
+	}
+}
+
+// Sign は常に低S値の署名を返す
+func TestSignReturnsLowS(t *testing.T) {
+	w, err := New()
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	hash := PayloadHash(w.Address, "bob", 10, 0)
+
+	sigHex, err := w.Sign(hash[:])
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+
+	sig, err := hex.DecodeString(sigHex)
+	if err != nil {
+		t.Fatalf("failed to decode signature: %v", err)
+	}
+	s := new(big.Int).SetBytes(sig[keySize:])
+	if s.Cmp(halfOrder) > 0 {
+		t.Fatal("expected Sign to normalize s to the low-S form")
+	}
+}
+
+// (r, s) が有効な署名でも、s の高S値バージョン (r, N-s) は可鍛性のある重複署名として拒否される
+func TestVerifyRejectsHighS(t *testing.T) {
+	w, err := New()
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	hash := PayloadHash(w.Address, "bob", 10, 0)
+
+	sigHex, err := w.Sign(hash[:])
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+	sig, err := hex.DecodeString(sigHex)
+	if err != nil {
+		t.Fatalf("failed to decode signature: %v", err)
+	}
+
+	r := new(big.Int).SetBytes(sig[:keySize])
+	s := new(big.Int).SetBytes(sig[keySize:])
+	highS := new(big.Int).Sub(curve.Params().N, s)
+	malleated := hex.EncodeToString(append(pad(r), pad(highS)...))
+
+	ok, err := Verify(&w.PrivateKey.PublicKey, malleated, hash[:])
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if ok {
+		t.Fatal("expected Verify to reject the high-S malleated signature")
+	}
+}